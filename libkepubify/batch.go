@@ -0,0 +1,109 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"runtime"
+	"unsafe"
+
+	"github.com/pgaskin/kepubify/v4/kepub"
+	"golang.org/x/sync/errgroup"
+)
+
+// ConvertBatch converts count EPUBs concurrently. inputs/inputLens are
+// parallel arrays of length count giving each entry's raw input bytes and
+// byte length. outputs/outputLens are parallel arrays of length count that
+// ConvertBatch fills in: outputs[i] is a C.malloc'd buffer (freed with
+// FreeBuffer) holding the converted KEPUB and outputLens[i] its length, or a
+// nil output with length -1 if that entry failed to convert. The worker pool
+// is capped at GOMAXPROCS so callers converting whole shelves of books don't
+// need to manage their own goroutines or pre-guess a single shared output
+// size. Returns the number of entries that converted successfully.
+//
+//export ConvertBatch
+func ConvertBatch(inputs **byte, inputLens *int, count int, outputs **byte, outputLens *int) int {
+	inputPtrs := unsafe.Slice(inputs, count)
+	inputLenSlice := unsafe.Slice(inputLens, count)
+	outputPtrs := unsafe.Slice(outputs, count)
+	outputLenSlice := unsafe.Slice(outputLens, count)
+
+	batchInputs := make([][]byte, count)
+	for i := range batchInputs {
+		batchInputs[i] = unsafe.Slice(inputPtrs[i], inputLenSlice[i])
+	}
+
+	n := 0
+	for i, r := range convertBatch(batchInputs) {
+		if r.err != nil {
+			outputPtrs[i] = nil
+			outputLenSlice[i] = -1
+			continue
+		}
+		cbuf := C.malloc(C.size_t(len(r.output)))
+		if len(r.output) > 0 {
+			copy(unsafe.Slice((*byte)(cbuf), len(r.output)), r.output)
+		}
+		outputPtrs[i] = (*byte)(cbuf)
+		outputLenSlice[i] = len(r.output)
+		n++
+	}
+	return n
+}
+
+// FreeBuffer releases a buffer returned via ConvertBatch's output field.
+//
+//export FreeBuffer
+func FreeBuffer(buf *byte) {
+	C.free(unsafe.Pointer(buf))
+}
+
+// batchResult is one convertBatch entry's outcome: either the converted
+// KEPUB bytes, or the error that entry failed with.
+type batchResult struct {
+	output []byte
+	err    error
+}
+
+// convertBatch converts each of inputs concurrently, capped at GOMAXPROCS
+// workers, and returns one result per input in the same order. It holds no
+// cgo types so it can be exercised directly by go test, unlike ConvertBatch
+// itself.
+func convertBatch(inputs [][]byte) []batchResult {
+	results := make([]batchResult, len(inputs))
+
+	var g errgroup.Group
+	g.SetLimit(runtime.GOMAXPROCS(0))
+	for i := range inputs {
+		i := i
+		g.Go(func() error {
+			output, err := convertOneBatchItem(inputs[i])
+			results[i] = batchResult{output: output, err: err}
+			return nil
+		})
+	}
+	g.Wait()
+	return results
+}
+
+func convertOneBatchItem(input []byte) ([]byte, error) {
+	var opts []kepub.ConverterOption
+	opts = append(opts, kepub.ConverterOptionCharset("utf-8"))
+	opts = append(opts, kepub.ConverterOptionDummyTitlepage(false))
+	converter := kepub.NewConverterWithOptions(opts...)
+
+	zipReader, err := zip.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	var output bytes.Buffer
+	if err := converter.Convert(context.Background(), &output, zipReader); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import "C"
+
+import (
+	"archive/zip"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// Filename charset identifiers, exposed across the C ABI as plain ints so
+// callers don't need to marshal strings just to pick a code page.
+const (
+	CharsetUTF8     = 0
+	CharsetAuto     = 1
+	CharsetGBK      = 2
+	CharsetShiftJIS = 3
+	CharsetCP437    = 4
+)
+
+// zipGeneralPurposeUTF8 is bit 11 of the zip general-purpose flag, which
+// marks a file name/comment as already being UTF-8 per the APPNOTE spec.
+const zipGeneralPurposeUTF8 = 0x800
+
+func charsetEncoding(charset int) encoding.Encoding {
+	switch charset {
+	case CharsetGBK:
+		return simplifiedchinese.GBK
+	case CharsetShiftJIS:
+		return japanese.ShiftJIS
+	case CharsetCP437:
+		return charmap.CodePage437
+	default:
+		return nil
+	}
+}
+
+// fixZipFilenameEncoding rewrites the names of zr's entries in place for
+// zips produced by writers that packed non-UTF-8 bytes into the name field
+// without setting the UTF-8 flag, e.g. EPUBs authored on CJK Windows
+// systems. It mirrors the filename-recovery fix from the bookhunter
+// project. charset selects the source code page; CharsetAuto decodes the
+// name with every known code page and keeps whichever result scores best
+// as plausible CJK/Latin filename text (see filenameScore), since GBK and
+// CP437 in particular will happily decode almost any byte sequence without
+// erroring and can't be disambiguated by decode success alone.
+func fixZipFilenameEncoding(zr *zip.Reader, charset int) {
+	if charset == CharsetUTF8 {
+		return
+	}
+	candidates := []int{charset}
+	if charset == CharsetAuto {
+		candidates = []int{CharsetGBK, CharsetShiftJIS, CharsetCP437}
+	}
+	for _, f := range zr.File {
+		if f.Flags&zipGeneralPurposeUTF8 != 0 {
+			continue
+		}
+		if utf8.ValidString(f.Name) {
+			continue
+		}
+		best := ""
+		bestScore := 0
+		found := false
+		for _, c := range candidates {
+			enc := charsetEncoding(c)
+			if enc == nil {
+				continue
+			}
+			decoded, err := enc.NewDecoder().String(f.Name)
+			if err != nil || !utf8.ValidString(decoded) {
+				continue
+			}
+			if score := filenameScore(decoded); !found || score > bestScore {
+				found, bestScore, best = true, score, decoded
+			}
+		}
+		if found {
+			f.Name = best
+		}
+	}
+}
+
+// filenameScore rates how plausible s is as a real filename, so auto-detect
+// can pick the best-decoding candidate instead of the first one that merely
+// doesn't error. It rewards scripts a code page is meant to decode (Han for
+// GBK, kana for Shift_JIS) and penalizes control characters, the box-
+// drawing/block-element glyphs that code pages like CP437 produce from
+// byte ranges a real filename wouldn't otherwise use, and halfwidth
+// katakana, which real Japanese filenames rarely use but which a GBK or
+// CP437 filename mis-decoded as Shift_JIS readily produces alongside
+// otherwise-plausible-looking Han glyphs.
+func filenameScore(s string) int {
+	score := 0
+	for _, r := range s {
+		switch {
+		case r >= 0xFF61 && r <= 0xFF9F: // halfwidth katakana/punctuation
+			score -= 5
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			score += 3
+		case unicode.Is(unicode.Han, r):
+			score += 2
+		case r == utf8.RuneError || unicode.IsControl(r):
+			score -= 10
+		case r >= 0x2500 && r <= 0x259F: // legacy box-drawing/block-element glyphs
+			score -= 5
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsSpace(r), strings.ContainsRune(".-_()[]~!,'", r):
+			score++
+		}
+	}
+	return score
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func TestConvertBatchMixedSuccessAndFailure(t *testing.T) {
+	valid := testEPUB(t)
+	garbage := []byte("not a zip file")
+
+	results := convertBatch([][]byte{valid, garbage})
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+
+	if results[0].err != nil {
+		t.Fatalf("valid EPUB: unexpected error: %v", results[0].err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(results[0].output), int64(len(results[0].output)))
+	if err != nil {
+		t.Fatalf("valid EPUB: output is not a valid zip: %v", err)
+	}
+	if _, err := zr.Open("OEBPS/chapter1.xhtml"); err != nil {
+		t.Errorf("valid EPUB: converted output missing chapter1.xhtml: %v", err)
+	}
+
+	if results[1].err == nil {
+		t.Errorf("garbage input: expected an error, got none")
+	}
+	if results[1].output != nil {
+		t.Errorf("garbage input: expected nil output, got %d bytes", len(results[1].output))
+	}
+}
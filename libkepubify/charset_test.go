@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// buildZipWithRawName returns an in-memory zip with a single entry whose
+// name is the raw (non-UTF-8-flagged) bytes produced by encoding name with
+// enc, mirroring a zip writer that packed a CJK filename into a legacy code
+// page without setting the UTF-8 general-purpose bit.
+func buildZipWithRawName(t *testing.T, name string, enc encoding.Encoding) []byte {
+	t.Helper()
+	rawName, err := enc.NewEncoder().String(name)
+	if err != nil {
+		t.Fatalf("encode %q: %v", name, err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	hdr := &zip.FileHeader{Name: rawName, Method: zip.Store}
+	hdr.Flags &^= zipGeneralPurposeUTF8
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		t.Fatalf("create header: %v", err)
+	}
+	if _, err := w.Write([]byte("content")); err != nil {
+		t.Fatalf("write content: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func openZip(t *testing.T, data []byte) *zip.Reader {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	return zr
+}
+
+func TestFixZipFilenameEncodingExplicitCharset(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset int
+		enc     encoding.Encoding
+		want    string
+	}{
+		{"GBK", CharsetGBK, simplifiedchinese.GBK, "封面.jpg"},
+		{"ShiftJIS", CharsetShiftJIS, japanese.ShiftJIS, "表紙.jpg"},
+		{"CP437", CharsetCP437, charmap.CodePage437, "café.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildZipWithRawName(t, tt.want, tt.enc)
+			zr := openZip(t, data)
+			fixZipFilenameEncoding(zr, tt.charset)
+			if got := zr.File[0].Name; got != tt.want {
+				t.Errorf("got name %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixZipFilenameEncodingUTF8Passthrough(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("封面.jpg")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := w.Write([]byte("content")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	zr := openZip(t, buf.Bytes())
+	fixZipFilenameEncoding(zr, CharsetGBK)
+	if got := zr.File[0].Name; got != "封面.jpg" {
+		t.Errorf("CharsetUTF8 entry was rewritten: got %q", got)
+	}
+}
+
+func TestFixZipFilenameEncodingAutoGBK(t *testing.T) {
+	want := "封面图片.jpg"
+	data := buildZipWithRawName(t, want, simplifiedchinese.GBK)
+	zr := openZip(t, data)
+	fixZipFilenameEncoding(zr, CharsetAuto)
+	if got := zr.File[0].Name; got != want {
+		t.Errorf("auto-detect GBK: got %q, want %q", got, want)
+	}
+}
+
+func TestFixZipFilenameEncodingAutoShiftJIS(t *testing.T) {
+	want := "表紙ひらがな.jpg"
+	data := buildZipWithRawName(t, want, japanese.ShiftJIS)
+	zr := openZip(t, data)
+	fixZipFilenameEncoding(zr, CharsetAuto)
+	if got := zr.File[0].Name; got != want {
+		t.Errorf("auto-detect Shift_JIS: got %q, want %q", got, want)
+	}
+}
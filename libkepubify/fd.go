@@ -0,0 +1,82 @@
+package main
+
+import "C"
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"syscall"
+	"unsafe"
+
+	"github.com/pgaskin/kepubify/v4/kepub"
+)
+
+// ConvertToFD converts the EPUB in input_raw/lenIn to KEPUB and streams the
+// output directly into fd, an OS file descriptor already open for writing,
+// instead of requiring the caller to size a single in-memory buffer. It
+// returns the number of bytes written, or a negative code on failure:
+// errZipOpen if input isn't a valid zip, errConvert if kepubify itself
+// failed (see LastError), or errConvert again if the write to fd failed
+// partway through.
+//
+// ConvertToFD writes via syscall.Write rather than wrapping fd in an
+// os.File: os.NewFile sets a finalizer that closes fd once the returned
+// *os.File is garbage-collected, and that finalizer lives on an internal,
+// unexported field the caller can't clear from here. Since ConvertToFD
+// doesn't own fd, going through os.File risks fd being closed (and its
+// number silently reused elsewhere in the process) at an unpredictable,
+// GC-determined moment.
+//
+//export ConvertToFD
+func ConvertToFD(input_raw *byte, lenIn int, fd int) int {
+	input := unsafe.Slice(input_raw, lenIn)
+	var opts []kepub.ConverterOption
+	opts = append(opts, kepub.ConverterOptionCharset("utf-8"))
+	opts = append(opts, kepub.ConverterOptionDummyTitlepage(false))
+	converter := kepub.NewConverterWithOptions(opts...)
+
+	zipReader, err := zip.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		setLastError(err)
+		return errZipOpen
+	}
+
+	w := &fdWriter{fd: fd}
+	if err := converter.Convert(context.Background(), w, zipReader); err != nil {
+		setLastError(err)
+		return errConvert
+	}
+	return w.n
+}
+
+// fdWriter writes every chunk it's given to fd via a raw syscall.Write,
+// retrying on EINTR, and tracks the total bytes written so ConvertToFD can
+// report a byte count without buffering converter.Convert's output to
+// measure it.
+type fdWriter struct {
+	fd int
+	n  int
+}
+
+func (w *fdWriter) Write(p []byte) (int, error) {
+	total := 0
+	for total < len(p) {
+		n, err := syscall.Write(w.fd, p[total:])
+		if n > 0 {
+			total += n
+			w.n += n
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, io.ErrShortWrite
+		}
+	}
+	return total, nil
+}
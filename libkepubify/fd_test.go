@@ -0,0 +1,146 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// multiChapterEPUB returns an EPUB with several chapters, large enough that
+// ConvertToFD's streamed output is worth comparing against the in-memory
+// Convert path rather than trivially equal by construction.
+func multiChapterEPUB(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name, content string) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	const chapterCount = 20
+	write("mimetype", "application/epub+zip")
+	write("META-INF/container.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`)
+
+	manifest := `<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`
+	spine := ""
+	nav := ""
+	for i := 1; i <= chapterCount; i++ {
+		name := "chapter" + strconv.Itoa(i)
+		manifest += `<item id="` + name + `" href="` + name + `.xhtml" media-type="application/xhtml+xml"/>`
+		spine += `<itemref idref="` + name + `"/>`
+		nav += `<li><a href="` + name + `.xhtml">Chapter ` + strconv.Itoa(i) + `</a></li>`
+		write("OEBPS/"+name+".xhtml", `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>`+name+`</title></head>
+<body><p>`+strings.Repeat("Some manga page text. ", 500)+`</p></body></html>`)
+	}
+
+	write("OEBPS/content.opf", `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="bookid">test-book</dc:identifier>
+    <dc:title>Test Book</dc:title>
+    <dc:language>en</dc:language>
+  </metadata>
+  <manifest>`+manifest+`</manifest>
+  <spine>`+spine+`</spine>
+</package>`)
+	write("OEBPS/nav.xhtml", `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>Nav</title></head>
+<body><nav epub:type="toc"><ol>`+nav+`</ol></nav></body>
+</html>`)
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// zipEntryContents decodes data as a zip and returns each entry's content
+// keyed by name, so two kepubs can be compared by what they contain rather
+// than by raw bytes: kepub.Converter.Convert transforms content files
+// concurrently across a worker pool and appends them to the output zip in
+// completion order, so two independent conversions of the same EPUB are not
+// guaranteed to be byte-identical even though every entry's content is.
+func zipEntryContents(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	entries := make(map[string][]byte, len(zr.File))
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		var b bytes.Buffer
+		_, err = b.ReadFrom(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		entries[f.Name] = b.Bytes()
+	}
+	return entries
+}
+
+func TestConvertToFDMatchesInMemory(t *testing.T) {
+	input := multiChapterEPUB(t)
+
+	memBuf := make([]byte, 8<<20)
+	n := Convert(&input[0], len(input), &memBuf[0], len(memBuf))
+	if n <= 0 {
+		t.Fatalf("Convert(multi-chapter epub) = %d", n)
+	}
+	memBuf = memBuf[:n]
+
+	f, err := os.CreateTemp("", "convert-to-fd-*.kepub")
+	if err != nil {
+		t.Fatalf("create temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	fdN := ConvertToFD(&input[0], len(input), int(f.Fd()))
+	if fdN <= 0 {
+		t.Fatalf("ConvertToFD(multi-chapter epub) = %d", fdN)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatalf("seek temp file: %v", err)
+	}
+	fdBuf := make([]byte, fdN)
+	if _, err := f.Read(fdBuf); err != nil {
+		t.Fatalf("read temp file: %v", err)
+	}
+
+	memEntries := zipEntryContents(t, memBuf)
+	fdEntries := zipEntryContents(t, fdBuf)
+	if len(memEntries) != len(fdEntries) {
+		t.Fatalf("ConvertToFD produced %d entries, Convert produced %d", len(fdEntries), len(memEntries))
+	}
+	for name, want := range memEntries {
+		got, ok := fdEntries[name]
+		if !ok {
+			t.Errorf("ConvertToFD output is missing entry %q present in Convert output", name)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("entry %q differs between ConvertToFD and Convert output", name)
+		}
+	}
+}
@@ -5,13 +5,76 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"sync"
 	"unsafe"
 
 	"github.com/pgaskin/kepubify/v4/kepub"
 )
 
+// Convert/ConvertWithCharset/ConvertWithOptions error codes, returned in
+// place of the byte count on failure.
+const (
+	errZipOpen = -1
+	errConvert = -2
+)
+
+// errBufferTooSmall encodes a required buffer size of needed bytes as a
+// negative return code. It reserves everything above errConvert (-1, -2) so
+// a too-small-buffer result can never be mistaken for one of the fixed error
+// sentinels, however small needed is.
+func errBufferTooSmall(needed int) int {
+	return -(needed + 3)
+}
+
+// lastErrMu guards lastErr, the most recent error message from Convert or
+// ConvertWithCharset. It's a single process-wide slot rather than one per
+// call: these two exports are one-shot (no handle to hang a message off of,
+// unlike the ConverterOpen/.../ConverterClose sessions in streaming.go), so a
+// caller that gets a negative return is expected to call LastError before
+// its next Convert call on another goroutine.
+var (
+	lastErrMu sync.Mutex
+	lastErr   string
+)
+
+func setLastError(err error) {
+	lastErrMu.Lock()
+	lastErr = err.Error()
+	lastErrMu.Unlock()
+}
+
+// LastError copies the message for the most recent Convert/ConvertWithCharset
+// failure into buf, truncating to lenBuf, and returns the number of bytes
+// copied.
+//
+//export LastError
+func LastError(buf *byte, lenBuf int) int {
+	lastErrMu.Lock()
+	msg := lastErr
+	lastErrMu.Unlock()
+	return copy(unsafe.Slice(buf, lenBuf), msg)
+}
+
+// Convert converts the EPUB in input_raw/lenIn to KEPUB and writes it to
+// buf/lenBuf. It returns the number of bytes written, or a negative code on
+// failure: errZipOpen if input isn't a valid zip, errConvert if kepubify
+// itself failed (see LastError for why), or errBufferTooSmall(required size)
+// if buf is too small to hold the output.
+//
+// It's a thin wrapper around ConvertWithOptions with an empty options
+// document, which is equivalent to utf-8 charset and no dummy titlepage.
+//
 //export Convert
 func Convert(input_raw *byte, lenIn int, buf *byte, lenBuf int) int {
+	return ConvertWithOptions(input_raw, lenIn, nil, 0, buf, lenBuf)
+}
+
+// ConvertWithCharset behaves like Convert, additionally recovering zip entry
+// names that were packed in charset instead of UTF-8 before conversion. Its
+// return codes are the same as Convert's.
+//
+//export ConvertWithCharset
+func ConvertWithCharset(input_raw *byte, lenIn int, buf *byte, lenBuf int, charset int) int {
 	input := unsafe.Slice(input_raw, lenIn)
 	var opts []kepub.ConverterOption
 	opts = append(opts, kepub.ConverterOptionCharset("utf-8"))
@@ -19,11 +82,17 @@ func Convert(input_raw *byte, lenIn int, buf *byte, lenBuf int) int {
 	converter := kepub.NewConverterWithOptions(opts...)
 	zipReader, err := zip.NewReader(bytes.NewReader(input), int64(len(input)))
 	if err != nil {
-		return -1
+		setLastError(err)
+		return errZipOpen
 	}
+	fixZipFilenameEncoding(zipReader, charset)
 	var output bytes.Buffer
 	if err := converter.Convert(context.Background(), &output, zipReader); err != nil {
-		return -1
+		setLastError(err)
+		return errConvert
+	}
+	if output.Len() > lenBuf {
+		return errBufferTooSmall(output.Len())
 	}
 	buffer := unsafe.Slice(buf, lenBuf)
 	return copy(buffer, output.Bytes())
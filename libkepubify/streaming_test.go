@@ -0,0 +1,112 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+// converterWriteAll feeds all of data into handle via repeated ConverterWrite
+// calls, failing the test if any call reports an error.
+func converterWriteAll(t *testing.T, handle int, data []byte) {
+	t.Helper()
+	if len(data) == 0 {
+		return
+	}
+	if n := ConverterWrite(handle, &data[0], len(data)); n != len(data) {
+		t.Fatalf("ConverterWrite: wrote %d bytes, want %d", n, len(data))
+	}
+}
+
+// converterReadAll drains handle's output via ConverterRead until clean EOF,
+// failing the test on the first error.
+func converterReadAll(t *testing.T, handle int) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	chunk := make([]byte, 4096)
+	for {
+		n := ConverterRead(handle, &chunk[0], len(chunk))
+		if n < 0 {
+			var errBuf [256]byte
+			m := ConverterLastError(handle, &errBuf[0], len(errBuf))
+			t.Fatalf("ConverterRead failed: %s", errBuf[:m])
+		}
+		if n == 0 {
+			return out.Bytes()
+		}
+		out.Write(chunk[:n])
+	}
+}
+
+func TestConverterStreamingRoundTrip(t *testing.T) {
+	handle := ConverterOpen()
+	if handle < 0 {
+		t.Fatalf("ConverterOpen failed")
+	}
+	defer ConverterClose(handle)
+
+	converterWriteAll(t, handle, testEPUB(t))
+	output := converterReadAll(t, handle)
+
+	zr, err := zip.NewReader(bytes.NewReader(output), int64(len(output)))
+	if err != nil {
+		t.Fatalf("streamed output is not a valid zip: %v", err)
+	}
+	if _, err := zr.Open("OEBPS/chapter1.xhtml"); err != nil {
+		t.Errorf("streamed output missing chapter1.xhtml: %v", err)
+	}
+}
+
+func TestConverterWriteAfterStartRejected(t *testing.T) {
+	handle := ConverterOpen()
+	if handle < 0 {
+		t.Fatalf("ConverterOpen failed")
+	}
+	defer ConverterClose(handle)
+
+	converterWriteAll(t, handle, testEPUB(t))
+	converterReadAll(t, handle) // starts the conversion
+
+	more := []byte("x")
+	if n := ConverterWrite(handle, &more[0], len(more)); n != -1 {
+		t.Errorf("ConverterWrite after conversion started: got %d, want -1", n)
+	}
+}
+
+// TestConverterReadCorruptInputTwice guards against a regression where a
+// failed first ConverterRead (zip.NewReader erroring on non-zip input) left
+// the session marked started with no pipe wired up, so a second
+// ConverterRead on the same handle nil-pointer-panicked in s.pr.Read
+// instead of returning the stored error again.
+func TestConverterReadCorruptInputTwice(t *testing.T) {
+	handle := ConverterOpen()
+	if handle < 0 {
+		t.Fatalf("ConverterOpen failed")
+	}
+	defer ConverterClose(handle)
+
+	converterWriteAll(t, handle, []byte("not a zip file"))
+
+	buf := make([]byte, 64)
+	for i := 0; i < 2; i++ {
+		if n := ConverterRead(handle, &buf[0], len(buf)); n != -1 {
+			t.Errorf("call %d: ConverterRead = %d, want -1", i, n)
+		}
+	}
+
+	var errBuf [256]byte
+	n := ConverterLastError(handle, &errBuf[0], len(errBuf))
+	if n == 0 {
+		t.Errorf("ConverterLastError returned no message after a failed conversion")
+	}
+}
+
+func TestConverterInvalidHandle(t *testing.T) {
+	buf := make([]byte, 16)
+	if n := ConverterRead(-1, &buf[0], len(buf)); n != -1 {
+		t.Errorf("ConverterRead on invalid handle: got %d, want -1", n)
+	}
+	if n := ConverterWrite(-1, &buf[0], 0); n != -1 {
+		t.Errorf("ConverterWrite on invalid handle: got %d, want -1", n)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestConvertErrorCodes(t *testing.T) {
+	input := testEPUB(t)
+
+	t.Run("not a zip", func(t *testing.T) {
+		garbage := []byte("not a zip file")
+		if got := Convert(&garbage[0], len(garbage), nil, 0); got != errZipOpen {
+			t.Errorf("Convert(garbage) = %d, want %d", got, errZipOpen)
+		}
+		var buf [256]byte
+		if n := LastError(&buf[0], len(buf)); n == 0 {
+			t.Errorf("LastError returned no message after a zip-open failure")
+		}
+	})
+
+	t.Run("buffer too small", func(t *testing.T) {
+		full := make([]byte, 1<<20)
+		full = full[:Convert(&input[0], len(input), &full[0], len(full))]
+
+		small := make([]byte, len(full)-1)
+		got := Convert(&input[0], len(input), &small[0], len(small))
+		if want := errBufferTooSmall(len(full)); got != want {
+			t.Errorf("Convert with undersized buffer = %d, want %d", got, want)
+		}
+		if got == errZipOpen || got == errConvert {
+			t.Errorf("Convert with undersized buffer = %d, collides with a fixed error sentinel", got)
+		}
+	})
+
+	t.Run("valid epub", func(t *testing.T) {
+		buf := make([]byte, 1<<20)
+		n := Convert(&input[0], len(input), &buf[0], len(buf))
+		if n <= 0 {
+			t.Fatalf("Convert(valid epub) = %d, want a positive byte count", n)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import "C"
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"unsafe"
+
+	"github.com/pgaskin/kepubify/v4/kepub"
+)
+
+// findReplaceRule is one entry of the ConvertOptions.FindReplace list: every
+// literal occurrence of Find in the book's (X)HTML is replaced with Replace.
+type findReplaceRule struct {
+	Find    string `json:"find"`
+	Replace string `json:"replace"`
+}
+
+// ConvertOptions is the JSON schema accepted by ConvertWithOptions, covering
+// the kepub.ConverterOption surface that the plain Convert export hardcodes.
+//
+//	{
+//	  "hyphenate": true,
+//	  "smart_quotes": true,
+//	  "smart_ellipsis": true,
+//	  "smart_dashes": true,
+//	  "extra_css": "body { font-family: serif; }",
+//	  "find_replace": [{"find": "foo", "replace": "bar"}],
+//	  "dummy_titlepage": false,
+//	  "charset": "utf-8"
+//	}
+//
+// The three smart_* fields all toggle the same underlying smartypants pass
+// (kepubify doesn't let quotes, ellipses, and dashes be enabled separately),
+// so setting any of them enables it. Every field is optional: hyphenate,
+// smart_*, extra_css, and find_replace are simply left unapplied when
+// omitted, charset defaults to "utf-8", and dummy_titlepage defaults to
+// false (matching Convert's hardcoded behavior) rather than leaving
+// kepubify's own titlepage-detection heuristic in effect.
+type ConvertOptions struct {
+	Hyphenate      *bool             `json:"hyphenate,omitempty"`
+	SmartQuotes    *bool             `json:"smart_quotes,omitempty"`
+	SmartEllipsis  *bool             `json:"smart_ellipsis,omitempty"`
+	SmartDashes    *bool             `json:"smart_dashes,omitempty"`
+	ExtraCSS       string            `json:"extra_css,omitempty"`
+	FindReplace    []findReplaceRule `json:"find_replace,omitempty"`
+	DummyTitlepage *bool             `json:"dummy_titlepage,omitempty"`
+	Charset        string            `json:"charset,omitempty"`
+}
+
+// smartypants reports whether any of the three smart_* fields asks for
+// kepubify's smart-punctuation pass, which kepub.ConverterOptionSmartypants
+// enables as a single all-or-nothing option.
+func (o ConvertOptions) smartypants() bool {
+	return (o.SmartQuotes != nil && *o.SmartQuotes) ||
+		(o.SmartEllipsis != nil && *o.SmartEllipsis) ||
+		(o.SmartDashes != nil && *o.SmartDashes)
+}
+
+// converterOptions maps a decoded ConvertOptions onto the kepub.ConverterOption
+// values kepub.NewConverterWithOptions expects.
+func (o ConvertOptions) converterOptions() []kepub.ConverterOption {
+	charset := o.Charset
+	if charset == "" {
+		charset = "utf-8"
+	}
+	opts := []kepub.ConverterOption{
+		kepub.ConverterOptionCharset(charset),
+	}
+	if o.Hyphenate != nil {
+		opts = append(opts, kepub.ConverterOptionHyphenate(*o.Hyphenate))
+	}
+	if o.smartypants() {
+		opts = append(opts, kepub.ConverterOptionSmartypants())
+	}
+	if o.ExtraCSS != "" {
+		opts = append(opts, kepub.ConverterOptionAddCSS(o.ExtraCSS))
+	}
+	for _, fr := range o.FindReplace {
+		opts = append(opts, kepub.ConverterOptionFindReplace(fr.Find, fr.Replace))
+	}
+	dummyTitlepage := false
+	if o.DummyTitlepage != nil {
+		dummyTitlepage = *o.DummyTitlepage
+	}
+	opts = append(opts, kepub.ConverterOptionDummyTitlepage(dummyTitlepage))
+	return opts
+}
+
+// ConvertWithOptions behaves like Convert but accepts a JSON-encoded
+// ConvertOptions document describing which of kepubify's converter options
+// to enable, instead of hardcoding utf-8 charset and no dummy titlepage.
+// Convert is a thin wrapper around this with an empty options document.
+//
+// Its return codes are the same as Convert's, plus errConvert (rather than a
+// dedicated code) if optionsJSON_raw/optionsJSONLen don't decode as a
+// ConvertOptions document.
+//
+//export ConvertWithOptions
+func ConvertWithOptions(input_raw *byte, lenIn int, optionsJSON_raw *byte, optionsJSONLen int, buf *byte, lenBuf int) int {
+	input := unsafe.Slice(input_raw, lenIn)
+
+	var options ConvertOptions
+	if optionsJSONLen > 0 {
+		optionsJSON := unsafe.Slice(optionsJSON_raw, optionsJSONLen)
+		if err := json.Unmarshal(optionsJSON, &options); err != nil {
+			setLastError(err)
+			return errConvert
+		}
+	}
+
+	converter := kepub.NewConverterWithOptions(options.converterOptions()...)
+	zipReader, err := zip.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		setLastError(err)
+		return errZipOpen
+	}
+	var output bytes.Buffer
+	if err := converter.Convert(context.Background(), &output, zipReader); err != nil {
+		setLastError(err)
+		return errConvert
+	}
+	if output.Len() > lenBuf {
+		return errBufferTooSmall(output.Len())
+	}
+	buffer := unsafe.Slice(buf, lenBuf)
+	return copy(buffer, output.Bytes())
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/kepubify/v4/kepub"
+)
+
+// testEPUB returns a minimal single-chapter EPUB whose chapter text
+// exercises every ConvertOptions knob: a literal token for find_replace,
+// straight punctuation for smartypants, and a long unbroken word for
+// hyphenation. extra_css needs no fixture support of its own since
+// kepub.ConverterOptionAddCSS injects an inline <style> into the chapter
+// document rather than touching the linked stylesheet.
+func testEPUB(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name, content string) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	write("mimetype", "application/epub+zip")
+	write("META-INF/container.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`)
+	write("OEBPS/content.opf", `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="bookid">test-book</dc:identifier>
+    <dc:title>Test Book</dc:title>
+    <dc:language>en</dc:language>
+  </metadata>
+  <manifest>
+    <item id="chapter1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+  </manifest>
+  <spine>
+    <itemref idref="chapter1"/>
+  </spine>
+</package>`)
+	write("OEBPS/nav.xhtml", `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>Nav</title></head>
+<body><nav epub:type="toc"><ol><li><a href="chapter1.xhtml">Chapter 1</a></li></ol></nav></body>
+</html>`)
+	write("OEBPS/style.css", `body { margin: 0; }`)
+	write("OEBPS/chapter1.xhtml", `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>Chapter 1</title><link rel="stylesheet" type="text/css" href="style.css"/></head>
+<body>
+<p>"REPLACE_ME" said the narrator -- a supercalifragilisticexpialidocious word indeed...</p>
+</body>
+</html>`)
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// convertWith runs input through kepub.NewConverterWithOptions(opts...), the
+// same call ConvertWithOptions makes, so a test failure here means an option
+// genuinely didn't reach the converter rather than a bug in our C ABI glue.
+func convertWith(t *testing.T, input []byte, opts []kepub.ConverterOption) []byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatalf("open input zip: %v", err)
+	}
+	var out bytes.Buffer
+	if err := kepub.NewConverterWithOptions(opts...).Convert(context.Background(), &out, zr); err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	return out.Bytes()
+}
+
+// fileInKepub returns the content of the first output entry whose name ends
+// in suffix.
+func fileInKepub(t *testing.T, kepubBytes []byte, suffix string) string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(kepubBytes), int64(len(kepubBytes)))
+	if err != nil {
+		t.Fatalf("open output zip: %v", err)
+	}
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, suffix) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		defer rc.Close()
+		var b bytes.Buffer
+		if _, err := b.ReadFrom(rc); err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		return b.String()
+	}
+	t.Fatalf("output has no entry ending in %q", suffix)
+	return ""
+}
+
+func TestConvertOptionsFindReplace(t *testing.T) {
+	input := testEPUB(t)
+	options := ConvertOptions{FindReplace: []findReplaceRule{{Find: "REPLACE_ME", Replace: "hello"}}}
+	chapter := fileInKepub(t, convertWith(t, input, options.converterOptions()), "chapter1.xhtml")
+	if strings.Contains(chapter, "REPLACE_ME") {
+		t.Errorf("find_replace: original text still present in output")
+	}
+	if !strings.Contains(chapter, "hello") {
+		t.Errorf("find_replace: replacement text missing from output")
+	}
+}
+
+func TestConvertOptionsExtraCSS(t *testing.T) {
+	input := testEPUB(t)
+	options := ConvertOptions{ExtraCSS: "p { color: red; }"}
+	chapter := fileInKepub(t, convertWith(t, input, options.converterOptions()), "chapter1.xhtml")
+	if !strings.Contains(chapter, "color: red") {
+		t.Errorf("extra_css: added rule missing from chapter's inline <style>, got %q", chapter)
+	}
+}
+
+func TestConvertOptionsSmartypants(t *testing.T) {
+	input := testEPUB(t)
+	plain := convertWith(t, input, ConvertOptions{}.converterOptions())
+
+	enabled := true
+	smart := convertWith(t, input, ConvertOptions{SmartQuotes: &enabled}.converterOptions())
+	if bytes.Equal(plain, smart) {
+		t.Errorf("smart_quotes: enabling it produced byte-identical output")
+	}
+}
+
+func TestConvertOptionsHyphenate(t *testing.T) {
+	input := testEPUB(t)
+	plain := convertWith(t, input, ConvertOptions{}.converterOptions())
+
+	enabled := true
+	hyphenated := convertWith(t, input, ConvertOptions{Hyphenate: &enabled}.converterOptions())
+	if bytes.Equal(plain, hyphenated) {
+		t.Errorf("hyphenate: enabling it produced byte-identical output")
+	}
+}
+
+func TestConvertOptionsDummyTitlepage(t *testing.T) {
+	input := testEPUB(t)
+	without := convertWith(t, input, ConvertOptions{}.converterOptions())
+
+	enabled := true
+	with := convertWith(t, input, ConvertOptions{DummyTitlepage: &enabled}.converterOptions())
+	if bytes.Equal(without, with) {
+		t.Errorf("dummy_titlepage: enabling it produced byte-identical output")
+	}
+}
+
+func TestConvertWithOptionsBadJSON(t *testing.T) {
+	input := testEPUB(t)
+	badJSON := []byte("not json")
+	buf := make([]byte, 1<<20)
+	got := ConvertWithOptions(&input[0], len(input), &badJSON[0], len(badJSON), &buf[0], len(buf))
+	if got != errConvert {
+		t.Errorf("ConvertWithOptions(bad json) = %d, want %d", got, errConvert)
+	}
+}
+
+func TestConvertMatchesConvertWithOptionsDefaults(t *testing.T) {
+	input := testEPUB(t)
+	viaConvert := make([]byte, 1<<20)
+	nConvert := Convert(&input[0], len(input), &viaConvert[0], len(viaConvert))
+
+	viaOptions := make([]byte, 1<<20)
+	nOptions := ConvertWithOptions(&input[0], len(input), nil, 0, &viaOptions[0], len(viaOptions))
+
+	if nConvert != nOptions {
+		t.Fatalf("Convert returned %d bytes, ConvertWithOptions(nil) returned %d", nConvert, nOptions)
+	}
+
+	// Compare decoded entries rather than raw bytes: kepub.Converter.Convert
+	// transforms content files concurrently across a worker pool and
+	// appends them to the output zip in completion order, so two
+	// independent conversions of the same EPUB aren't guaranteed to be
+	// byte-identical even though every entry's content is.
+	convertEntries := zipEntryContents(t, viaConvert[:nConvert])
+	optionsEntries := zipEntryContents(t, viaOptions[:nOptions])
+	if len(convertEntries) != len(optionsEntries) {
+		t.Fatalf("Convert produced %d entries, ConvertWithOptions(nil) produced %d", len(convertEntries), len(optionsEntries))
+	}
+	for name, want := range convertEntries {
+		got, ok := optionsEntries[name]
+		if !ok {
+			t.Errorf("ConvertWithOptions(nil) output is missing entry %q present in Convert output", name)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("entry %q differs between Convert and ConvertWithOptions(nil) output", name)
+		}
+	}
+}
+
+func TestConvertOptionsCharsetDefault(t *testing.T) {
+	opts := ConvertOptions{}.converterOptions()
+	if len(opts) == 0 {
+		t.Fatalf("converterOptions returned no options")
+	}
+	input := testEPUB(t)
+	if _, err := zip.NewReader(bytes.NewReader(convertWith(t, input, opts)), int64(len(convertWith(t, input, opts)))); err != nil {
+		t.Fatalf("conversion with default charset produced an unreadable archive: %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+/*
+#include <stddef.h>
+
+typedef void (*manget_read_callback)(void *userdata, const char *data, int length);
+
+static void manget_call_read_callback(manget_read_callback cb, void *userdata, const char *data, int length) {
+	cb(userdata, data, length);
+}
+*/
+import "C"
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/pgaskin/kepubify/v4/kepub"
+)
+
+// converterSession backs one ConverterOpen/.../ConverterClose lifecycle. The
+// input EPUB is buffered to a growable temp file rather than memory, since
+// zip.NewReader needs random access to the central directory that kepubify
+// can only see once the whole archive has arrived; the output side streams
+// through an io.Pipe so callers never need to pre-size a destination buffer.
+type converterSession struct {
+	mu        sync.Mutex
+	input     *os.File
+	inputSize int64
+	started   bool
+	startErr  error
+	pr        *io.PipeReader
+	pw        *io.PipeWriter
+	lastErr   string
+}
+
+var (
+	sessions   sync.Map // map[int32]*converterSession
+	sessionSeq int32
+
+	// lastGlobalErr holds the error from the narrow window before a handle
+	// exists (currently only ConverterOpen's temp-file creation), where
+	// there's no *converterSession to attach it to. It is a single
+	// process-wide slot guarded by a mutex, not a true thread-local: two
+	// embedder threads that both fail a handle-less call concurrently can
+	// read back each other's message. Every other error is recorded on its
+	// own session and doesn't share this race.
+	lastGlobalErrMu sync.Mutex
+	lastGlobalErr   string
+)
+
+func setGlobalError(err error) {
+	lastGlobalErrMu.Lock()
+	defer lastGlobalErrMu.Unlock()
+	lastGlobalErr = err.Error()
+}
+
+func (s *converterSession) setError(err error) {
+	s.mu.Lock()
+	s.lastErr = err.Error()
+	s.mu.Unlock()
+}
+
+// ConverterOpen creates a new streaming conversion session and returns its
+// handle, or -1 if a temp file could not be created (see ConverterLastError).
+//
+//export ConverterOpen
+func ConverterOpen() int {
+	f, err := os.CreateTemp("", "manget-convert-*.epub")
+	if err != nil {
+		setGlobalError(err)
+		return -1
+	}
+	handle := atomic.AddInt32(&sessionSeq, 1)
+	sessions.Store(handle, &converterSession{input: f})
+	return int(handle)
+}
+
+// ConverterWrite appends a chunk of the input EPUB to the session identified
+// by handle. It must be called before the first ConverterRead. Returns the
+// number of bytes written, or -1 on error.
+//
+//export ConverterWrite
+func ConverterWrite(handle int, data *byte, length int) int {
+	s, err := lookupSession(handle)
+	if err != nil {
+		return -1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		s.lastErr = "ConverterWrite called after conversion has started"
+		return -1
+	}
+	chunk := unsafe.Slice(data, length)
+	n, err := s.input.Write(chunk)
+	s.inputSize += int64(n)
+	if err != nil {
+		s.lastErr = err.Error()
+		return -1
+	}
+	return n
+}
+
+// ConverterRead pulls up to len(buf) bytes of converted KEPUB output from the
+// session, starting the conversion on the first call. Returns the number of
+// bytes read, 0 on clean end-of-stream, or -1 on error.
+//
+//export ConverterRead
+func ConverterRead(handle int, buf *byte, lenBuf int) int {
+	s, err := lookupSession(handle)
+	if err != nil {
+		return -1
+	}
+	if err := s.ensureStarted(); err != nil {
+		s.setError(err)
+		return -1
+	}
+	out := unsafe.Slice(buf, lenBuf)
+	n, err := s.pr.Read(out)
+	if err != nil && err != io.EOF {
+		s.setError(err)
+		return -1
+	}
+	return n
+}
+
+// ConverterReadCallback drains the rest of the session's output, invoking cb
+// once per chunk, until EOF or an error. Returns 0 on success, -1 on error.
+//
+//export ConverterReadCallback
+func ConverterReadCallback(handle int, cb C.manget_read_callback, userdata unsafe.Pointer) int {
+	s, err := lookupSession(handle)
+	if err != nil {
+		return -1
+	}
+	if err := s.ensureStarted(); err != nil {
+		s.setError(err)
+		return -1
+	}
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := s.pr.Read(chunk)
+		if n > 0 {
+			C.manget_call_read_callback(cb, userdata, (*C.char)(unsafe.Pointer(&chunk[0])), C.int(n))
+		}
+		if err == io.EOF {
+			return 0
+		}
+		if err != nil {
+			s.setError(err)
+			return -1
+		}
+	}
+}
+
+// ConverterClose releases the temp file and output pipe backing handle.
+//
+//export ConverterClose
+func ConverterClose(handle int) {
+	v, ok := sessions.LoadAndDelete(int32(handle))
+	if !ok {
+		return
+	}
+	s := v.(*converterSession)
+	if s.pr != nil {
+		s.pr.Close()
+	}
+	name := s.input.Name()
+	s.input.Close()
+	os.Remove(name)
+}
+
+// ConverterLastError copies the last error message recorded for handle (or
+// the last session-independent error if handle is invalid) into buf,
+// truncating to lenBuf. Returns the number of bytes copied.
+//
+//export ConverterLastError
+func ConverterLastError(handle int, buf *byte, lenBuf int) int {
+	msg := ""
+	if s, err := lookupSession(handle); err == nil {
+		s.mu.Lock()
+		msg = s.lastErr
+		s.mu.Unlock()
+	} else {
+		lastGlobalErrMu.Lock()
+		msg = lastGlobalErr
+		lastGlobalErrMu.Unlock()
+	}
+	out := unsafe.Slice(buf, lenBuf)
+	return copy(out, msg)
+}
+
+func lookupSession(handle int) (*converterSession, error) {
+	v, ok := sessions.Load(int32(handle))
+	if !ok {
+		return nil, errInvalidHandle
+	}
+	return v.(*converterSession), nil
+}
+
+var errInvalidHandle = &handleError{"invalid or closed converter handle"}
+
+type handleError struct{ msg string }
+
+func (e *handleError) Error() string { return e.msg }
+
+// ensureStarted kicks off the conversion goroutine the first time the
+// caller asks to read output, reading the buffered input through the zip
+// central directory exactly once. Once called, it is never retried: later
+// calls replay the same outcome (including any error) so that a failed
+// start can't be mistaken for success by a caller that reads again, and
+// can't leave s.pr nil while s.started is true.
+func (s *converterSession) ensureStarted() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return s.startErr
+	}
+	s.started = true
+
+	zipReader, err := zip.NewReader(s.input, s.inputSize)
+	if err != nil {
+		s.startErr = err
+		return err
+	}
+	pr, pw := io.Pipe()
+	s.pr, s.pw = pr, pw
+
+	var opts []kepub.ConverterOption
+	opts = append(opts, kepub.ConverterOptionCharset("utf-8"))
+	opts = append(opts, kepub.ConverterOptionDummyTitlepage(false))
+	converter := kepub.NewConverterWithOptions(opts...)
+
+	go func() {
+		err := converter.Convert(context.Background(), pw, zipReader)
+		pw.CloseWithError(err)
+	}()
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import "C"
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"path"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/net/html"
+)
+
+// koboSpanClass is the class kepubify gives every span it wraps around a
+// paragraph/sentence so Kobo devices can track reading position.
+const koboSpanClass = "koboSpan"
+
+// kepubBookWrapperIDs are the ids of the nested divs kepubify wraps around
+// the whole body for Kobo's reflow/column engine. Matched by exact id,
+// mirroring koboInjectedStyleClasses below, rather than a "book-" prefix that
+// would also unwrap an unrelated div a source EPUB happens to id that way.
+var kepubBookWrapperIDs = map[string]bool{
+	"book-columns": true,
+	"book-inner":   true,
+}
+
+// koboInjectedStyleClasses are the exact class values kepubify's
+// transformContentAddStyle gives the inline <style> elements it appends to
+// every content document's <head> (kobostylehacks unconditionally, the rest
+// depending on which ConverterOptions were used). kepubify (as of v4.0.4)
+// never writes these out as separate CSS/JS files kept in the archive, so
+// unlike the scaffolding above there's no corresponding asset or manifest
+// entry to drop — only the inline block itself.
+var koboInjectedStyleClasses = map[string]bool{
+	"kobostylehacks":           true,
+	"kepubify-extracss":        true,
+	"kepubify-hyphenate":       true,
+	"kepubify-nohyphenate":     true,
+	"kepubify-fullscreenfixes": true,
+}
+
+// Unconvert reverses a kepubify EPUB->KEPUB conversion: it unwraps the
+// koboSpan/book-columns/book-inner scaffolding kepubify injects into every
+// (X)HTML document, drops the injected kobostylehacks/kepubify-* inline
+// <style> blocks, and restores a plain stored mimetype entry, recovering a
+// clean EPUB suitable for further editing. Returns the number of bytes
+// written to buf, or -1 on error.
+//
+//export Unconvert
+func Unconvert(input_raw *byte, lenIn int, buf *byte, lenBuf int) int {
+	input := unsafe.Slice(input_raw, lenIn)
+	zr, err := zip.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		return -1
+	}
+
+	order := make([]string, 0, len(zr.File))
+	entries := make(map[string][]byte, len(zr.File))
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return -1
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return -1
+		}
+		order = append(order, f.Name)
+		entries[f.Name] = data
+	}
+
+	for _, name := range order {
+		if !isHTMLDocument(name) {
+			continue
+		}
+		cleaned, err := stripKoboMarkup(entries[name])
+		if err != nil {
+			return -1
+		}
+		entries[name] = cleaned
+	}
+
+	var out bytes.Buffer
+	zw := zip.NewWriter(&out)
+	if _, ok := entries["mimetype"]; ok {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+		if err != nil {
+			return -1
+		}
+		if _, err := w.Write([]byte("application/epub+zip")); err != nil {
+			return -1
+		}
+	}
+	for _, name := range order {
+		if name == "mimetype" {
+			continue
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			return -1
+		}
+		if _, err := w.Write(entries[name]); err != nil {
+			return -1
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return -1
+	}
+
+	buffer := unsafe.Slice(buf, lenBuf)
+	return copy(buffer, out.Bytes())
+}
+
+func isHTMLDocument(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".html", ".xhtml", ".htm":
+		return true
+	default:
+		return false
+	}
+}
+
+// elemMarkup records what's being done with a currently-open element so its
+// matching end tag (and any of its descendants) are handled the same way.
+type elemMarkup struct {
+	unwrap bool // tag itself is dropped, contents are kept
+	drop   bool // element and everything inside it, including text, is dropped
+}
+
+// stripKoboMarkup unwraps koboSpan spans and the book-columns/book-inner
+// wrapper divs from an (X)HTML document, preserving their contents, and
+// drops kepubify's injected <style class="kobostylehacks">/"kepubify-extracss">
+// etc. blocks entirely, since unlike the scaffolding above their content
+// isn't meant to survive the round trip. It walks doc token-by-token and
+// re-emits each token's own raw bytes verbatim rather than parsing into a
+// tree and re-rendering, since golang.org/x/net/html's Render only ever
+// produces HTML5 output: it would inject missing <html>/<head>/<body>, drop
+// the XML declaration and DOCTYPE, and emit void elements in non-polyglot
+// form, none of which round-trip as valid XHTML.
+func stripKoboMarkup(doc []byte) ([]byte, error) {
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	var out bytes.Buffer
+	var open []elemMarkup // one entry per currently-open element, innermost last
+
+	inDroppedSubtree := func() bool {
+		return len(open) > 0 && open[len(open)-1].drop
+	}
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			return out.Bytes(), nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			selfClosing := tok.Type == html.SelfClosingTagToken
+			m := elemMarkup{drop: inDroppedSubtree() || shouldDropStyle(tok)}
+			m.unwrap = !m.drop && shouldUnwrapTag(tok)
+			if !m.drop && !m.unwrap {
+				out.Write(z.Raw())
+			}
+			if !selfClosing {
+				open = append(open, m)
+			}
+		case html.EndTagToken:
+			var m elemMarkup
+			if n := len(open); n > 0 {
+				m = open[n-1]
+				open = open[:n-1]
+			}
+			if !m.drop && !m.unwrap {
+				out.Write(z.Raw())
+			}
+		default:
+			if !inDroppedSubtree() {
+				out.Write(z.Raw())
+			}
+		}
+	}
+}
+
+func shouldUnwrapTag(tok html.Token) bool {
+	switch tok.Data {
+	case "span":
+		return hasClass(tok, koboSpanClass)
+	case "div":
+		return kepubBookWrapperIDs[tokenAttr(tok, "id")]
+	default:
+		return false
+	}
+}
+
+func shouldDropStyle(tok html.Token) bool {
+	return tok.Data == "style" && koboInjectedStyleClasses[tokenAttr(tok, "class")]
+}
+
+func hasClass(tok html.Token, class string) bool {
+	for _, c := range strings.Fields(tokenAttr(tok, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func tokenAttr(tok html.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/kepubify/v4/kepub"
+)
+
+// buildRealKepub runs testEPUB through the actual kepub.Converter with the
+// same options Convert uses, so the fixture reflects what kepubify really
+// produces (koboSpan/book-columns/book-inner scaffolding plus an inline
+// kobostylehacks <style> in every content document's <head>) rather than a
+// hand-rolled guess at its output.
+func buildRealKepub(t *testing.T) []byte {
+	t.Helper()
+	return convertWith(t, testEPUB(t), []kepub.ConverterOption{
+		kepub.ConverterOptionCharset("utf-8"),
+		kepub.ConverterOptionDummyTitlepage(false),
+	})
+}
+
+func readZipEntry(t *testing.T, data []byte, name string) (string, bool) {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", name, err)
+		}
+		defer rc.Close()
+		b, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		return string(b), true
+	}
+	return "", false
+}
+
+func TestUnconvertDropsInjectedStyleAndScaffolding(t *testing.T) {
+	input := buildRealKepub(t)
+	out := make([]byte, 64*1024)
+	n := Unconvert(&input[0], len(input), &out[0], len(out))
+	if n < 0 {
+		t.Fatalf("Unconvert failed")
+	}
+	output := out[:n]
+
+	chapter, ok := readZipEntry(t, output, "OEBPS/chapter1.xhtml")
+	if !ok {
+		t.Fatalf("chapter1.xhtml missing from output")
+	}
+	if strings.Contains(chapter, "koboSpan") || strings.Contains(chapter, "book-columns") || strings.Contains(chapter, "book-inner") {
+		t.Errorf("kobo scaffolding not stripped, got %q", chapter)
+	}
+	if strings.Contains(chapter, "kobostylehacks") || strings.Contains(chapter, "<style") {
+		t.Errorf("injected kobostylehacks <style> not stripped, got %q", chapter)
+	}
+	if !strings.Contains(chapter, "said the narrator") {
+		t.Errorf("chapter text was lost, got %q", chapter)
+	}
+	if !strings.Contains(chapter, `href="style.css"`) {
+		t.Errorf("link to the source EPUB's own stylesheet was wrongly removed, got %q", chapter)
+	}
+	if !strings.Contains(chapter, `<?xml version="1.0" encoding="UTF-8"?>`) {
+		t.Errorf("XML declaration was lost in the round trip, got %q", chapter)
+	}
+
+	if _, ok := readZipEntry(t, output, "OEBPS/style.css"); !ok {
+		t.Errorf("source EPUB's own stylesheet was dropped from the archive")
+	}
+}